@@ -0,0 +1,74 @@
+// Package lfs implements parsing of Git LFS pointer files, the small
+// text blobs that replace actual file content in repositories tracked
+// with Git LFS.
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// MaxPointerSize is the maximum size in bytes a blob can have to be
+// considered for LFS pointer parsing. Pointer files are a handful of
+// short text lines, so anything bigger is assumed to be real content
+// and should not be read just to find out it isn't a pointer.
+const MaxPointerSize = 200
+
+const pointerVersionPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// Pointer holds the metadata encoded in a Git LFS pointer file.
+type Pointer struct {
+	// Oid is the sha256 of the actual blob content, as stored by LFS.
+	Oid string
+	// Size is the size in bytes of the actual blob content.
+	Size int64
+}
+
+// Parse parses content as a Git LFS pointer file. It returns false as
+// the second result if content is larger than MaxPointerSize or does
+// not look like a valid pointer.
+func Parse(content []byte) (*Pointer, bool) {
+	if len(content) > MaxPointerSize {
+		return nil, false
+	}
+
+	if !bytes.HasPrefix(content, []byte(pointerVersionPrefix)) {
+		return nil, false
+	}
+
+	var (
+		oid             string
+		size            int64
+		sawOid, sawSize bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "oid sha256:"):
+			oid = strings.TrimPrefix(line, "oid sha256:")
+			sawOid = true
+		case strings.HasPrefix(line, "size "):
+			n, err := strconv.ParseInt(strings.TrimPrefix(line, "size "), 10, 64)
+			if err != nil {
+				return nil, false
+			}
+
+			size = n
+			sawSize = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, false
+	}
+
+	if !sawOid || !sawSize || oid == "" {
+		return nil, false
+	}
+
+	return &Pointer{Oid: oid, Size: size}, true
+}
@@ -0,0 +1,55 @@
+package lfs
+
+import "testing"
+
+func TestParseValidPointer(t *testing.T) {
+	content := []byte("version https://git-lfs.github.com/spec/v1\n" +
+		"oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e239\n" +
+		"size 12345\n")
+
+	ptr, ok := Parse(content)
+	if !ok {
+		t.Fatal("expected a valid pointer")
+	}
+
+	if ptr.Oid != "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e239" {
+		t.Fatalf("unexpected oid: %q", ptr.Oid)
+	}
+
+	if ptr.Size != 12345 {
+		t.Fatalf("unexpected size: %d", ptr.Size)
+	}
+}
+
+func TestParseNotAPointer(t *testing.T) {
+	if _, ok := Parse([]byte("just some regular file content\n")); ok {
+		t.Fatal("expected regular content not to parse as a pointer")
+	}
+}
+
+func TestParseTooLarge(t *testing.T) {
+	content := []byte("version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 1\n")
+	for len(content) <= MaxPointerSize {
+		content = append(content, '#')
+	}
+
+	if _, ok := Parse(content); ok {
+		t.Fatal("expected a blob above MaxPointerSize to be rejected without being parsed")
+	}
+}
+
+func TestParseMissingFields(t *testing.T) {
+	cases := map[string][]byte{
+		"missing size": []byte("version https://git-lfs.github.com/spec/v1\noid sha256:abc\n"),
+		"missing oid":  []byte("version https://git-lfs.github.com/spec/v1\nsize 1\n"),
+		"empty":        []byte(""),
+	}
+
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := Parse(content); ok {
+				t.Fatalf("expected %q to be rejected as an incomplete pointer", name)
+			}
+		})
+	}
+}
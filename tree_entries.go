@@ -5,9 +5,12 @@ import (
 	"strconv"
 
 	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/src-d/go-mysql-server.v0/sql/expression"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/sumbach/gitbase/lfs"
 )
 
 type treeEntriesTable struct{}
@@ -19,8 +22,22 @@ var TreeEntriesSchema = sql.Schema{
 	{Name: "blob_hash", Type: sql.Text, Nullable: false, Source: TreeEntriesTableName},
 	{Name: "tree_entry_mode", Type: sql.Text, Nullable: false, Source: TreeEntriesTableName},
 	{Name: "tree_entry_name", Type: sql.Text, Nullable: false, Source: TreeEntriesTableName},
+	{Name: "blob_size", Type: sql.Int64, Nullable: false, Source: TreeEntriesTableName},
+	{Name: "blob_content", Type: sql.Blob, Nullable: false, Source: TreeEntriesTableName},
+	{Name: "lfs_oid", Type: sql.Text, Nullable: true, Source: TreeEntriesTableName},
+	{Name: "lfs_size", Type: sql.Int64, Nullable: true, Source: TreeEntriesTableName},
+	{Name: "tree_entry", Type: TreeEntryType, Nullable: false, Source: TreeEntriesTableName},
 }
 
+// TreeEntryType is the struct type of the tree_entry column, bundling an
+// entry's name, mode and blob hash into a single value so it can be
+// projected, grouped or passed around as one unit instead of three.
+var TreeEntryType = sql.Struct(sql.Schema{
+	{Name: "name", Type: sql.Text},
+	{Name: "mode", Type: sql.Text},
+	{Name: "blob_hash", Type: sql.Text},
+})
+
 var _ sql.PushdownProjectionAndFiltersTable = (*treeEntriesTable)(nil)
 
 func newTreeEntriesTable() sql.Table {
@@ -53,7 +70,7 @@ func (r *treeEntriesTable) TransformExpressionsUp(f sql.TransformExprFunc) (sql.
 
 func (r treeEntriesTable) RowIter(ctx *sql.Context) (sql.RowIter, error) {
 	span, ctx := ctx.Span("gitbase.TreeEntriesTable")
-	iter := new(treeEntryIter)
+	iter := &treeEntryIter{needContent: true, needLFS: true}
 
 	repoIter, err := NewRowRepoIter(ctx, iter)
 	if err != nil {
@@ -74,18 +91,22 @@ func (treeEntriesTable) HandledFilters(filters []sql.Expression) []sql.Expressio
 
 func (r *treeEntriesTable) WithProjectAndFilters(
 	ctx *sql.Context,
-	_, filters []sql.Expression,
+	project, filters []sql.Expression,
 ) (sql.RowIter, error) {
 	span, ctx := ctx.Span("gitbase.TreeEntriesTable")
+
+	needContent := columnIsProjected(project, "blob_content")
+	needLFS := columnIsProjected(project, "lfs_oid") || columnIsProjected(project, "lfs_size")
+
 	// TODO: could be optimized even more checking that only tree_hash is
 	// projected. There would be no need to iterate files in this case, and
 	// it would be much faster.
 	iter, err := rowIterWithSelectors(
 		ctx, TreeEntriesSchema, TreeEntriesTableName, filters,
-		[]string{"tree_hash"},
+		[]string{"tree_hash", "repository_id"},
 		func(selectors selectors) (RowRepoIter, error) {
 			if len(selectors["tree_hash"]) == 0 {
-				return new(treeEntryIter), nil
+				return &treeEntryIter{needContent: needContent, needLFS: needLFS}, nil
 			}
 
 			hashes, err := selectors.textValues("tree_hash")
@@ -93,7 +114,17 @@ func (r *treeEntriesTable) WithProjectAndFilters(
 				return nil, err
 			}
 
-			return &treeEntriesByHashIter{hashes: hashes}, nil
+			if useParallelTreeEntries(selectors) {
+				return newParallelTreeEntriesIter(
+					ctx, hashes, selectors["repository_id"], needContent, needLFS,
+				), nil
+			}
+
+			return &treeEntriesByHashIter{
+				hashes:      hashes,
+				needContent: needContent,
+				needLFS:     needLFS,
+			}, nil
 		},
 	)
 
@@ -105,6 +136,40 @@ func (r *treeEntriesTable) WithProjectAndFilters(
 	return sql.NewSpanIter(span, iter), nil
 }
 
+// columnIsProjected reports whether the given column name is referenced
+// anywhere in project. An empty projection means "all columns", as is
+// the case for a plain SELECT *.
+func columnIsProjected(project []sql.Expression, name string) bool {
+	if len(project) == 0 {
+		return true
+	}
+
+	for _, e := range project {
+		if exprReferencesColumn(e, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func exprReferencesColumn(e sql.Expression, name string) bool {
+	switch e := e.(type) {
+	case *expression.GetField:
+		return e.Name() == name
+	case *expression.Alias:
+		return exprReferencesColumn(e.Child, name)
+	default:
+		for _, child := range e.Children() {
+			if exprReferencesColumn(child, name) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
 func (r treeEntriesTable) String() string {
 	return printTable(TreeEntriesTableName, TreeEntriesSchema)
 }
@@ -113,6 +178,9 @@ type treeEntryIter struct {
 	i      *object.TreeIter
 	fi     *fileIter
 	repoID string
+
+	needContent bool
+	needLFS     bool
 }
 
 func (i *treeEntryIter) NewIterator(repo *Repository) (RowRepoIter, error) {
@@ -121,7 +189,12 @@ func (i *treeEntryIter) NewIterator(repo *Repository) (RowRepoIter, error) {
 		return nil, err
 	}
 
-	return &treeEntryIter{repoID: repo.ID, i: iter}, nil
+	return &treeEntryIter{
+		repoID:      repo.ID,
+		i:           iter,
+		needContent: i.needContent,
+		needLFS:     i.needLFS,
+	}, nil
 }
 
 func (i *treeEntryIter) Next() (sql.Row, error) {
@@ -132,7 +205,13 @@ func (i *treeEntryIter) Next() (sql.Row, error) {
 				return nil, err
 			}
 
-			i.fi = &fileIter{repoID: i.repoID, t: tree, fi: tree.Files()}
+			i.fi = &fileIter{
+				repoID:      i.repoID,
+				t:           tree,
+				fi:          tree.Files(),
+				needContent: i.needContent,
+				needLFS:     i.needLFS,
+			}
 		}
 
 		row, err := i.fi.Next()
@@ -160,10 +239,18 @@ type treeEntriesByHashIter struct {
 	pos    int
 	repo   *Repository
 	fi     *fileIter
+
+	needContent bool
+	needLFS     bool
 }
 
 func (i *treeEntriesByHashIter) NewIterator(repo *Repository) (RowRepoIter, error) {
-	return &treeEntriesByHashIter{hashes: i.hashes, repo: repo}, nil
+	return &treeEntriesByHashIter{
+		hashes:      i.hashes,
+		repo:        repo,
+		needContent: i.needContent,
+		needLFS:     i.needLFS,
+	}, nil
 }
 
 func (i *treeEntriesByHashIter) Next() (sql.Row, error) {
@@ -184,7 +271,13 @@ func (i *treeEntriesByHashIter) Next() (sql.Row, error) {
 				return nil, err
 			}
 
-			i.fi = &fileIter{repoID: i.repo.ID, t: tree, fi: tree.Files()}
+			i.fi = &fileIter{
+				repoID:      i.repo.ID,
+				t:           tree,
+				fi:          tree.Files(),
+				needContent: i.needContent,
+				needLFS:     i.needLFS,
+			}
 		}
 
 		row, err := i.fi.Next()
@@ -207,6 +300,9 @@ type fileIter struct {
 	repoID string
 	t      *object.Tree
 	fi     *object.FileIter
+
+	needContent bool
+	needLFS     bool
 }
 
 func (i *fileIter) Next() (sql.Row, error) {
@@ -215,7 +311,7 @@ func (i *fileIter) Next() (sql.Row, error) {
 		return nil, err
 	}
 
-	return fileToRow(i.repoID, i.t, f), nil
+	return fileToRow(i.repoID, i.t, f, i.needContent, i.needLFS)
 }
 
 func (i *fileIter) Close() error {
@@ -223,12 +319,55 @@ func (i *fileIter) Close() error {
 	return nil
 }
 
-func fileToRow(repoID string, t *object.Tree, f *object.File) sql.Row {
+func fileToRow(
+	repoID string,
+	t *object.Tree,
+	f *object.File,
+	needContent bool,
+	needLFS bool,
+) (sql.Row, error) {
+	var content []byte
+	var lfsOid, lfsSize interface{}
+
+	if needLFS && f.Size <= lfs.MaxPointerSize {
+		data, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+
+		if ptr, ok := lfs.Parse([]byte(data)); ok {
+			lfsOid = ptr.Oid
+			lfsSize = ptr.Size
+		}
+
+		if needContent {
+			content = []byte(data)
+		}
+	} else if needContent {
+		data, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+
+		content = []byte(data)
+	}
+
+	mode := strconv.FormatInt(int64(f.Mode), 8)
+
 	return sql.NewRow(
 		repoID,
 		t.ID().String(),
 		f.Hash.String(),
-		strconv.FormatInt(int64(f.Mode), 8),
+		mode,
 		f.Name,
-	)
+		f.Size,
+		content,
+		lfsOid,
+		lfsSize,
+		map[string]interface{}{
+			"name":      f.Name,
+			"mode":      mode,
+			"blob_hash": f.Hash.String(),
+		},
+	), nil
 }
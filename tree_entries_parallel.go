@@ -0,0 +1,276 @@
+package gitbase
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// GITBASE_TREE_ENTRIES_PARALLELISM overrides the number of repositories
+// processed concurrently by the tree_hash IN (...) pushdown. It defaults
+// to DefaultTreeEntriesParallelism.
+const treeEntriesParallelismVar = "GITBASE_TREE_ENTRIES_PARALLELISM"
+
+// DefaultTreeEntriesParallelism is the number of repositories that will
+// be walked concurrently when the parallel tree_hash pushdown kicks in.
+const DefaultTreeEntriesParallelism = 4
+
+// parallelHashThreshold is the number of requested tree hashes above
+// which the parallel pushdown is used even without an explicit
+// repository_id filter.
+const parallelHashThreshold = 32
+
+func treeEntriesParallelism() int {
+	if v := os.Getenv(treeEntriesParallelismVar); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+
+	return DefaultTreeEntriesParallelism
+}
+
+// useParallelTreeEntries decides whether the tree_hash IN (...) pushdown
+// should fan its work out across repositories instead of visiting them
+// one at a time, as treeEntriesByHashIter does.
+func useParallelTreeEntries(selectors selectors) bool {
+	hashes := selectors["tree_hash"]
+	if len(hashes) == 0 {
+		return false
+	}
+
+	return len(selectors["repository_id"]) > 0 || len(hashes) > parallelHashThreshold
+}
+
+// parallelTreeEntriesIter resolves a tree_hash IN (...) lookup with a
+// fixed-size pool of GITBASE_TREE_ENTRIES_PARALLELISM workers, each
+// pulling repositories off a shared queue and running a
+// treeEntriesByHashIter against them, merging their rows through a
+// buffered channel. Sizing the pool to the repository count would spawn
+// one goroutine per repository, which doesn't bound anything for a large
+// repo fleet; pulling from a queue keeps goroutine count capped at the
+// pool size no matter how many repositories are selected. It mirrors the
+// producer/consumer pattern the go-mysql-server handler uses to stream
+// query results: an errgroup drives the pool, and cancelling the
+// iterator (e.g. because the client disconnected) stops it and drains
+// the channel so no goroutine leaks.
+type parallelTreeEntriesIter struct {
+	ctx         *sql.Context
+	hashes      []string
+	repoIDs     []string
+	needContent bool
+	needLFS     bool
+
+	// produceRepo defaults to i.produce. Tests override it to drive the
+	// pool's queue/worker/Close machinery without a real session, repo
+	// pool or git storage behind it.
+	produceRepo func(ctx context.Context, repo *Repository) error
+
+	started bool
+	rows    chan sql.Row
+	done    chan struct{}
+	err     error
+	cancel  context.CancelFunc
+}
+
+func newParallelTreeEntriesIter(
+	ctx *sql.Context,
+	hashes, repoIDs []string,
+	needContent, needLFS bool,
+) *parallelTreeEntriesIter {
+	return &parallelTreeEntriesIter{
+		ctx:         ctx,
+		hashes:      hashes,
+		repoIDs:     repoIDs,
+		needContent: needContent,
+		needLFS:     needLFS,
+	}
+}
+
+// NewIterator is called once per repository in the session's pool by the
+// generic rowRepoIter driver. The first call takes ownership of the whole
+// pool and spins up the worker pool; later calls just see an iterator
+// that is already exhausted, so the driver quickly moves on.
+func (i *parallelTreeEntriesIter) NewIterator(repo *Repository) (RowRepoIter, error) {
+	if i.started {
+		return new(exhaustedRowRepoIter), nil
+	}
+
+	i.started = true
+	if err := i.start(); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (i *parallelTreeEntriesIter) start() error {
+	s, err := getSession(i.ctx)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(i.repoIDs))
+	for _, id := range i.repoIDs {
+		wanted[id] = true
+	}
+
+	repoIter, err := s.Pool.RepoIter()
+	if err != nil {
+		return err
+	}
+
+	var repos []*Repository
+	for {
+		repo, err := repoIter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(wanted) > 0 && !wanted[repo.ID] {
+			continue
+		}
+
+		repos = append(repos, repo)
+	}
+
+	i.runPool(repos)
+	return nil
+}
+
+// runPool spins up the fixed-size worker pool over repos and wires up the
+// rows/done channels that Next and Close read from. It's split out of
+// start so tests can drive the pool directly against fake repos, without
+// a real session or repo pool behind it.
+func (i *parallelTreeEntriesIter) runPool(repos []*Repository) {
+	groupCtx, cancel := context.WithCancel(i.ctx.Context)
+	group, groupCtx := errgroup.WithContext(groupCtx)
+
+	parallelism := treeEntriesParallelism()
+	i.rows = make(chan sql.Row, parallelism*4)
+	i.cancel = cancel
+
+	produce := i.produce
+	if i.produceRepo != nil {
+		produce = i.produceRepo
+	}
+
+	queue := make(chan *Repository)
+	group.Go(func() error {
+		defer close(queue)
+		for _, repo := range repos {
+			select {
+			case queue <- repo:
+			case <-groupCtx.Done():
+				return groupCtx.Err()
+			}
+		}
+
+		return nil
+	})
+
+	workers := parallelism
+	if len(repos) < workers {
+		workers = len(repos)
+	}
+
+	for w := 0; w < workers; w++ {
+		group.Go(func() error {
+			for repo := range queue {
+				if err := produce(groupCtx, repo); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	// done is closed, never sent on, so that both the ordinary EOF path
+	// in Next and a later call to Close can read it without the second
+	// reader blocking forever: a value can only be received once, but a
+	// closed channel always yields immediately. i.err is safe to read
+	// after that receive because the close happens-after the write.
+	i.done = make(chan struct{})
+	go func() {
+		i.err = group.Wait()
+		close(i.rows)
+		close(i.done)
+	}()
+}
+
+func (i *parallelTreeEntriesIter) produce(ctx context.Context, repo *Repository) error {
+	iter := &treeEntriesByHashIter{
+		hashes:      i.hashes,
+		repo:        repo,
+		needContent: i.needContent,
+		needLFS:     i.needLFS,
+	}
+
+	for {
+		row, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case i.rows <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (i *parallelTreeEntriesIter) Next() (sql.Row, error) {
+	row, ok := <-i.rows
+	if !ok {
+		<-i.done
+		if i.err != nil {
+			return nil, i.err
+		}
+
+		return nil, io.EOF
+	}
+
+	return row, nil
+}
+
+func (i *parallelTreeEntriesIter) Close() error {
+	if i.cancel != nil {
+		i.cancel()
+	}
+
+	if i.rows != nil {
+		for range i.rows {
+		}
+	}
+
+	if i.done != nil {
+		<-i.done
+	}
+
+	return nil
+}
+
+// exhaustedRowRepoIter is handed to every repository but the first one
+// parallelTreeEntriesIter is driven for, since it already consumed the
+// whole pool itself.
+type exhaustedRowRepoIter struct{}
+
+func (exhaustedRowRepoIter) NewIterator(repo *Repository) (RowRepoIter, error) {
+	return new(exhaustedRowRepoIter), nil
+}
+
+func (exhaustedRowRepoIter) Next() (sql.Row, error) { return nil, io.EOF }
+
+func (exhaustedRowRepoIter) Close() error { return nil }
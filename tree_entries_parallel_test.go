@@ -0,0 +1,167 @@
+package gitbase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// newTestParallelIter builds a parallelTreeEntriesIter wired up to run
+// over fake repos through produceRepo, bypassing the real session/repo
+// pool and git storage that start() would otherwise need.
+func newTestParallelIter(ctx *sql.Context, produce func(ctx context.Context, repo *Repository) error) *parallelTreeEntriesIter {
+	return &parallelTreeEntriesIter{
+		ctx:         ctx,
+		produceRepo: produce,
+	}
+}
+
+func drain(t *testing.T, i *parallelTreeEntriesIter) []sql.Row {
+	t.Helper()
+
+	var rows []sql.Row
+	for {
+		row, err := i.Next()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+func closeWithTimeout(t *testing.T, i *parallelTreeEntriesIter) {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() { done <- i.Close() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error from Close: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return in time")
+	}
+}
+
+func TestParallelTreeEntriesIterDrainsAllRepos(t *testing.T) {
+	ctx := sql.NewContext(context.Background())
+	repos := []*Repository{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	var i *parallelTreeEntriesIter
+	i = newTestParallelIter(ctx, func(ctx context.Context, repo *Repository) error {
+		i.rows <- sql.NewRow(repo.ID)
+		return nil
+	})
+	i.runPool(repos)
+
+	rows := drain(t, i)
+	if len(rows) != len(repos) {
+		t.Fatalf("expected %d rows, got %d", len(repos), len(rows))
+	}
+
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		seen[row[0].(string)] = true
+	}
+
+	for _, repo := range repos {
+		if !seen[repo.ID] {
+			t.Fatalf("missing row for repo %q", repo.ID)
+		}
+	}
+}
+
+// TestParallelTreeEntriesIterCloseAfterEOF is the regression test for the
+// deadlock the ordinary (non-cancelled) drain path used to hit: Next used
+// to observe EOF by consuming the one value ever sent on done, and a
+// subsequent Close then blocked forever trying to consume it again.
+func TestParallelTreeEntriesIterCloseAfterEOF(t *testing.T) {
+	ctx := sql.NewContext(context.Background())
+	repos := []*Repository{{ID: "a"}}
+
+	var i *parallelTreeEntriesIter
+	i = newTestParallelIter(ctx, func(ctx context.Context, repo *Repository) error {
+		i.rows <- sql.NewRow(repo.ID)
+		return nil
+	})
+	i.runPool(repos)
+
+	drain(t, i)
+	closeWithTimeout(t, i)
+}
+
+func TestParallelTreeEntriesIterCloseCancelsInFlightProducers(t *testing.T) {
+	ctx := sql.NewContext(context.Background())
+	repos := []*Repository{{ID: "a"}, {ID: "b"}}
+
+	started := make(chan struct{}, len(repos))
+	i := newTestParallelIter(ctx, func(ctx context.Context, repo *Repository) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	i.runPool(repos)
+
+	for range repos {
+		<-started
+	}
+
+	closeWithTimeout(t, i)
+}
+
+func TestParallelTreeEntriesIterWorkerPoolIsBounded(t *testing.T) {
+	ctx := sql.NewContext(context.Background())
+
+	const repoCount = 8
+	repos := make([]*Repository, repoCount)
+	for n := range repos {
+		repos[n] = &Repository{ID: fmt.Sprintf("repo-%d", n)}
+	}
+
+	parallelism := int32(treeEntriesParallelism())
+	if parallelism > repoCount {
+		parallelism = repoCount
+	}
+
+	var inFlight, maxInFlight int32
+	atStart := make(chan struct{}, repoCount)
+	release := make(chan struct{})
+
+	i := newTestParallelIter(ctx, func(ctx context.Context, repo *Repository) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		atStart <- struct{}{}
+		<-release
+		atomic.AddInt32(&inFlight, -1)
+		return nil
+	})
+	i.runPool(repos)
+
+	for n := int32(0); n < parallelism; n++ {
+		<-atStart
+	}
+	close(release)
+
+	drain(t, i)
+
+	if got := atomic.LoadInt32(&maxInFlight); got > parallelism {
+		t.Fatalf("expected at most %d concurrent producers, saw %d", parallelism, got)
+	}
+}
@@ -0,0 +1,307 @@
+package gitbase
+
+import (
+	"io"
+	"path"
+	"strconv"
+
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// TreeEntriesRecursiveTableName is the name of the tree_entries_recursive
+// table.
+const TreeEntriesRecursiveTableName = "tree_entries_recursive"
+
+type treeEntriesRecursiveTable struct{}
+
+// TreeEntriesRecursiveSchema is the schema for the tree_entries_recursive
+// table. Unlike tree_entries, it yields the full POSIX path of every
+// entry reachable from a root tree, including those nested in subtrees,
+// without the caller having to self-join tree_entries against itself.
+var TreeEntriesRecursiveSchema = sql.Schema{
+	{Name: "repository_id", Type: sql.Text, Nullable: false, Source: TreeEntriesRecursiveTableName},
+	{Name: "root_tree_hash", Type: sql.Text, Nullable: false, Source: TreeEntriesRecursiveTableName},
+	{Name: "path", Type: sql.Text, Nullable: false, Source: TreeEntriesRecursiveTableName},
+	{Name: "blob_hash", Type: sql.Text, Nullable: false, Source: TreeEntriesRecursiveTableName},
+	{Name: "mode", Type: sql.Text, Nullable: false, Source: TreeEntriesRecursiveTableName},
+	{Name: "depth", Type: sql.Int64, Nullable: false, Source: TreeEntriesRecursiveTableName},
+}
+
+var _ sql.PushdownProjectionAndFiltersTable = (*treeEntriesRecursiveTable)(nil)
+
+func newTreeEntriesRecursiveTable() sql.Table {
+	return new(treeEntriesRecursiveTable)
+}
+
+var _ Table = (*treeEntriesRecursiveTable)(nil)
+
+func (treeEntriesRecursiveTable) isGitbaseTable() {}
+
+func (treeEntriesRecursiveTable) Resolved() bool {
+	return true
+}
+
+func (treeEntriesRecursiveTable) Name() string {
+	return TreeEntriesRecursiveTableName
+}
+
+func (treeEntriesRecursiveTable) Schema() sql.Schema {
+	return TreeEntriesRecursiveSchema
+}
+
+func (r *treeEntriesRecursiveTable) TransformUp(f sql.TransformNodeFunc) (sql.Node, error) {
+	return f(r)
+}
+
+func (r *treeEntriesRecursiveTable) TransformExpressionsUp(f sql.TransformExprFunc) (sql.Node, error) {
+	return r, nil
+}
+
+func (r treeEntriesRecursiveTable) RowIter(ctx *sql.Context) (sql.RowIter, error) {
+	span, ctx := ctx.Span("gitbase.TreeEntriesRecursiveTable")
+	iter := new(treeEntriesRecursiveIter)
+
+	repoIter, err := NewRowRepoIter(ctx, iter)
+	if err != nil {
+		span.Finish()
+		return nil, err
+	}
+
+	return sql.NewSpanIter(span, repoIter), nil
+}
+
+func (treeEntriesRecursiveTable) Children() []sql.Node {
+	return nil
+}
+
+func (treeEntriesRecursiveTable) HandledFilters(filters []sql.Expression) []sql.Expression {
+	return handledFilters(TreeEntriesRecursiveTableName, TreeEntriesRecursiveSchema, filters)
+}
+
+func (r *treeEntriesRecursiveTable) WithProjectAndFilters(
+	ctx *sql.Context,
+	_, filters []sql.Expression,
+) (sql.RowIter, error) {
+	span, ctx := ctx.Span("gitbase.TreeEntriesRecursiveTable")
+	iter, err := rowIterWithSelectors(
+		ctx, TreeEntriesRecursiveSchema, TreeEntriesRecursiveTableName, filters,
+		[]string{"root_tree_hash"},
+		func(selectors selectors) (RowRepoIter, error) {
+			if len(selectors["root_tree_hash"]) == 0 {
+				return new(treeEntriesRecursiveIter), nil
+			}
+
+			hashes, err := selectors.textValues("root_tree_hash")
+			if err != nil {
+				return nil, err
+			}
+
+			return &treeEntriesRecursiveByHashIter{hashes: hashes}, nil
+		},
+	)
+
+	if err != nil {
+		span.Finish()
+		return nil, err
+	}
+
+	return sql.NewSpanIter(span, iter), nil
+}
+
+func (r treeEntriesRecursiveTable) String() string {
+	return printTable(TreeEntriesRecursiveTableName, TreeEntriesRecursiveSchema)
+}
+
+type treeEntriesRecursiveIter struct {
+	i      *object.TreeIter
+	repoID string
+	walker *treeWalker
+}
+
+func (i *treeEntriesRecursiveIter) NewIterator(repo *Repository) (RowRepoIter, error) {
+	iter, err := repo.Repo.TreeObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	return &treeEntriesRecursiveIter{repoID: repo.ID, i: iter}, nil
+}
+
+func (i *treeEntriesRecursiveIter) Next() (sql.Row, error) {
+	for {
+		if i.walker == nil {
+			tree, err := i.i.Next()
+			if err != nil {
+				return nil, err
+			}
+
+			i.walker = newTreeWalker(i.repoID, tree)
+		}
+
+		row, err := i.walker.next()
+		if err == io.EOF {
+			i.walker = nil
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return row, nil
+	}
+}
+
+func (i *treeEntriesRecursiveIter) Close() error {
+	if i.i != nil {
+		i.i.Close()
+	}
+
+	return nil
+}
+
+type treeEntriesRecursiveByHashIter struct {
+	hashes []string
+	pos    int
+	repo   *Repository
+	walker *treeWalker
+}
+
+func (i *treeEntriesRecursiveByHashIter) NewIterator(repo *Repository) (RowRepoIter, error) {
+	return &treeEntriesRecursiveByHashIter{hashes: i.hashes, repo: repo}, nil
+}
+
+func (i *treeEntriesRecursiveByHashIter) Next() (sql.Row, error) {
+	for {
+		if i.pos >= len(i.hashes) && i.walker == nil {
+			return nil, io.EOF
+		}
+
+		if i.walker == nil {
+			hash := plumbing.NewHash(i.hashes[i.pos])
+			i.pos++
+			tree, err := i.repo.Repo.TreeObject(hash)
+			if err == plumbing.ErrObjectNotFound {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			i.walker = newTreeWalker(i.repo.ID, tree)
+		}
+
+		row, err := i.walker.next()
+		if err == io.EOF {
+			i.walker = nil
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return row, nil
+	}
+}
+
+func (i *treeEntriesRecursiveByHashIter) Close() error {
+	return nil
+}
+
+// treeWalkFrame is one level of the explicit DFS stack treeWalker keeps,
+// so walking a deeply nested tree can't blow the Go call stack the way a
+// recursive implementation would.
+type treeWalkFrame struct {
+	tree   *object.Tree
+	prefix string
+	depth  int
+	idx    int
+}
+
+// treeWalker performs a depth-first walk of a single root tree, yielding
+// one row per non-directory entry reachable from it, each with its full
+// POSIX path relative to the root. Subtrees are descended into but get no
+// row of their own.
+//
+// Dedup only guards against re-entering a tree that is already an
+// ancestor of the current frame (a genuine cycle in the walk). Git tree
+// hashes are content-addressed, so two unrelated directories can
+// legitimately share the same hash when they hold identical content
+// (duplicated vendor dirs, two packages with one identical file, an
+// empty directory, etc.); each such directory is a distinct path in the
+// result and must be walked in full, so a single "visited once, ever"
+// set would silently drop real files.
+type treeWalker struct {
+	repoID string
+	root   string
+	stack  []*treeWalkFrame
+}
+
+func newTreeWalker(repoID string, tree *object.Tree) *treeWalker {
+	return &treeWalker{
+		repoID: repoID,
+		root:   tree.ID().String(),
+		stack:  []*treeWalkFrame{{tree: tree}},
+	}
+}
+
+// onStack reports whether hash belongs to a tree that is currently an
+// ancestor frame of the walk, i.e. descending into it again would be a
+// cycle rather than a legitimate revisit of sibling content.
+func (w *treeWalker) onStack(hash plumbing.Hash) bool {
+	for _, frame := range w.stack {
+		if frame.tree.ID() == hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *treeWalker) next() (sql.Row, error) {
+	for len(w.stack) > 0 {
+		frame := w.stack[len(w.stack)-1]
+
+		if frame.idx >= len(frame.tree.Entries) {
+			w.stack = w.stack[:len(w.stack)-1]
+			continue
+		}
+
+		entry := frame.tree.Entries[frame.idx]
+		frame.idx++
+
+		entryPath := path.Join(frame.prefix, entry.Name)
+		depth := frame.depth + 1
+
+		if entry.Mode == filemode.Dir {
+			if w.onStack(entry.Hash) {
+				continue
+			}
+
+			subtree, err := frame.tree.Tree(entry.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			w.stack = append(w.stack, &treeWalkFrame{
+				tree:   subtree,
+				prefix: entryPath,
+				depth:  depth,
+			})
+			continue
+		}
+
+		return sql.NewRow(
+			w.repoID,
+			w.root,
+			entryPath,
+			entry.Hash.String(),
+			strconv.FormatInt(int64(entry.Mode), 8),
+			int64(depth),
+		), nil
+	}
+
+	return nil, io.EOF
+}
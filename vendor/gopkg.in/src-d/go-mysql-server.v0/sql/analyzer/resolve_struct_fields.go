@@ -0,0 +1,154 @@
+package analyzer
+
+import (
+	"strings"
+
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/src-d/go-mysql-server.v0/sql/expression"
+)
+
+const resolveStructFieldsRule = "resolve_struct_fields"
+
+// structFields is implemented by any sql.Type that exposes named
+// sub-fields, such as the type returned by sql.Struct. It is checked
+// structurally so this rule doesn't need to import a concrete struct
+// type from the sql package.
+type structFields interface {
+	Fields() sql.Schema
+}
+
+// StructFieldGetter is an expression that reads a single named field out
+// of a struct-typed value, the same way a plain column reference reads a
+// value out of a row.
+type StructFieldGetter struct {
+	Parent    sql.Expression
+	FieldName string
+	fieldType sql.Type
+}
+
+// NewStructFieldGetter creates a StructFieldGetter that reads FieldName
+// out of the struct value parent evaluates to.
+func NewStructFieldGetter(parent sql.Expression, fieldName string, fieldType sql.Type) *StructFieldGetter {
+	return &StructFieldGetter{Parent: parent, FieldName: fieldName, fieldType: fieldType}
+}
+
+// Resolved implements sql.Expression.
+func (e *StructFieldGetter) Resolved() bool { return e.Parent.Resolved() }
+
+// IsNullable implements sql.Expression. Field access is always nullable:
+// either the field wasn't populated for this row, or the struct itself
+// is NULL.
+func (e *StructFieldGetter) IsNullable() bool { return true }
+
+// Type implements sql.Expression.
+func (e *StructFieldGetter) Type() sql.Type { return e.fieldType }
+
+// Name implements sql.Expression.
+func (e *StructFieldGetter) Name() string {
+	return e.Parent.Name() + "." + e.FieldName
+}
+
+// String implements sql.Expression.
+func (e *StructFieldGetter) String() string {
+	return e.Name()
+}
+
+// Children implements sql.Expression.
+func (e *StructFieldGetter) Children() []sql.Expression {
+	return []sql.Expression{e.Parent}
+}
+
+// TransformUp implements sql.Expression.
+func (e *StructFieldGetter) TransformUp(f sql.TransformExprFunc) (sql.Expression, error) {
+	parent, err := e.Parent.TransformUp(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return f(NewStructFieldGetter(parent, e.FieldName, e.fieldType))
+}
+
+// Eval implements sql.Expression. Struct values are represented as
+// map[string]interface{} keyed by field name, as produced by tables with
+// a struct-typed column (see gitbase's tree_entry column, for instance).
+func (e *StructFieldGetter) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	v, err := e.Parent.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, nil
+	}
+
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	return fields[e.FieldName], nil
+}
+
+// resolveStructFields resolves a qualified column reference such as
+// "te.tree_entry.name" into a StructFieldGetter over the struct-typed
+// "tree_entry" column, the same way go-mysql-server resolves a plain
+// "te.tree_entry" reference into a GetField over that column. It runs
+// after normal column resolution, so any column it sees still
+// unresolved must be a struct field access: the first dot-separated
+// segment names a struct column on the child schema, and the rest names
+// one of its fields.
+func resolveStructFields(ctx *sql.Context, a *Analyzer, n sql.Node) (sql.Node, error) {
+	return n.TransformUp(func(n sql.Node) (sql.Node, error) {
+		return n.TransformExpressionsUp(func(e sql.Expression) (sql.Expression, error) {
+			uc, ok := e.(column)
+			if !ok || uc.Resolved() {
+				return e, nil
+			}
+
+			dot := strings.Index(uc.Name(), ".")
+			if dot <= 0 {
+				return e, nil
+			}
+
+			structCol, fieldName := uc.Name()[:dot], uc.Name()[dot+1:]
+
+			schema := n.Schema()
+			for i, col := range schema {
+				if col.Name != structCol {
+					continue
+				}
+
+				st, ok := col.Type.(structFields)
+				if !ok {
+					return e, nil
+				}
+
+				for _, field := range st.Fields() {
+					if field.Name != fieldName {
+						continue
+					}
+
+					base := expression.NewGetField(i, col.Type, structCol, col.Nullable)
+					return NewStructFieldGetter(base, fieldName, field.Type), nil
+				}
+			}
+
+			return e, nil
+		})
+	})
+}
+
+// column is implemented by the unresolved column expressions the parser
+// produces for "table.column"-shaped references, before the ordinary
+// column-resolution rule turns them into GetFields.
+type column interface {
+	sql.Expression
+	Name() string
+}
+
+// StructFieldResolutionRule resolves struct field access (see
+// resolveStructFields) and should run in the analyzer's rule chain right
+// after ordinary column resolution and before DefaultValidationRules, so
+// that validateGroupBy and validateProjectTuples see a plain,
+// already-typed expression rather than an unresolved dotted name.
+var StructFieldResolutionRule = Rule{resolveStructFieldsRule, resolveStructFields}
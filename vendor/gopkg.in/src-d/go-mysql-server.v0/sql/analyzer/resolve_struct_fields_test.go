@@ -0,0 +1,138 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/src-d/go-mysql-server.v0/sql/expression"
+)
+
+// fakeColumn is the unresolved "table.column"-shaped expression the
+// parser produces, before any resolution rule has run.
+type fakeColumn struct {
+	name string
+}
+
+func (c *fakeColumn) Resolved() bool                                              { return false }
+func (c *fakeColumn) IsNullable() bool                                            { return true }
+func (c *fakeColumn) Type() sql.Type                                              { return sql.Text }
+func (c *fakeColumn) Name() string                                                { return c.name }
+func (c *fakeColumn) String() string                                              { return c.name }
+func (c *fakeColumn) Children() []sql.Expression                                  { return nil }
+func (c *fakeColumn) TransformUp(f sql.TransformExprFunc) (sql.Expression, error) { return f(c) }
+func (c *fakeColumn) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	return nil, nil
+}
+
+// fakeNode is the minimal sql.Node needed to drive resolveStructFields:
+// a fixed schema plus a single expression to rewrite.
+type fakeNode struct {
+	schema sql.Schema
+	expr   sql.Expression
+}
+
+func (n *fakeNode) Resolved() bool       { return n.expr.Resolved() }
+func (n *fakeNode) String() string       { return "fakeNode" }
+func (n *fakeNode) Schema() sql.Schema   { return n.schema }
+func (n *fakeNode) Children() []sql.Node { return nil }
+
+func (n *fakeNode) TransformUp(f sql.TransformNodeFunc) (sql.Node, error) {
+	return f(n)
+}
+
+func (n *fakeNode) TransformExpressionsUp(f sql.TransformExprFunc) (sql.Node, error) {
+	expr, err := n.expr.TransformUp(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeNode{schema: n.schema, expr: expr}, nil
+}
+
+func TestResolveStructFieldsResolvesKnownField(t *testing.T) {
+	structType := sql.Struct(sql.Schema{
+		{Name: "name", Type: sql.Text},
+		{Name: "mode", Type: sql.Text},
+	})
+
+	n := &fakeNode{
+		schema: sql.Schema{{Name: "tree_entry", Type: structType}},
+		expr:   &fakeColumn{name: "tree_entry.name"},
+	}
+
+	resolved, err := resolveStructFields(sql.NewContext(context.Background()), nil, n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, ok := resolved.(*fakeNode).expr.(*StructFieldGetter)
+	if !ok {
+		t.Fatalf("expected a *StructFieldGetter, got %T", resolved.(*fakeNode).expr)
+	}
+
+	if got.FieldName != "name" {
+		t.Fatalf("expected field %q, got %q", "name", got.FieldName)
+	}
+
+	parent, ok := got.Parent.(*expression.GetField)
+	if !ok {
+		t.Fatalf("expected the getter's parent to be a *expression.GetField, got %T", got.Parent)
+	}
+
+	if parent.Name() != "tree_entry" {
+		t.Fatalf("expected the parent to reference column %q, got %q", "tree_entry", parent.Name())
+	}
+}
+
+func TestResolveStructFieldsLeavesUnknownColumnUntouched(t *testing.T) {
+	structType := sql.Struct(sql.Schema{{Name: "name", Type: sql.Text}})
+
+	n := &fakeNode{
+		schema: sql.Schema{{Name: "tree_entry", Type: structType}},
+		expr:   &fakeColumn{name: "other.name"},
+	}
+
+	resolved, err := resolveStructFields(sql.NewContext(context.Background()), nil, n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := resolved.(*fakeNode).expr.(*fakeColumn); !ok {
+		t.Fatalf("expected the unmatched column to be left alone, got %T", resolved.(*fakeNode).expr)
+	}
+}
+
+func TestResolveStructFieldsLeavesUnknownFieldUntouched(t *testing.T) {
+	structType := sql.Struct(sql.Schema{{Name: "name", Type: sql.Text}})
+
+	n := &fakeNode{
+		schema: sql.Schema{{Name: "tree_entry", Type: structType}},
+		expr:   &fakeColumn{name: "tree_entry.missing"},
+	}
+
+	resolved, err := resolveStructFields(sql.NewContext(context.Background()), nil, n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := resolved.(*fakeNode).expr.(*fakeColumn); !ok {
+		t.Fatalf("expected a reference to a field the struct doesn't have to be left alone, got %T", resolved.(*fakeNode).expr)
+	}
+}
+
+func TestResolveStructFieldsSkipsAlreadyResolvedExpressions(t *testing.T) {
+	n := &fakeNode{
+		schema: sql.Schema{{Name: "t", Type: sql.Text}},
+		expr:   col("t"),
+	}
+
+	resolved, err := resolveStructFields(sql.NewContext(context.Background()), nil, n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resolved.(*fakeNode).expr != n.expr {
+		t.Fatal("expected an already-resolved expression to be left untouched")
+	}
+}
@@ -0,0 +1,51 @@
+package analyzer
+
+import "gopkg.in/src-d/go-mysql-server.v0/sql"
+
+// RuleFunc is an analyzer rule's transformation: unlike a ValidationRule,
+// which only inspects a plan and returns an error, a Rule rewrites it,
+// and is given the Analyzer driving it so it can recurse into sub-plans
+// (subqueries, views) through the same rule chain.
+type RuleFunc func(ctx *sql.Context, a *Analyzer, n sql.Node) (sql.Node, error)
+
+// Rule is a named analyzer rewrite rule.
+type Rule struct {
+	Name  string
+	Apply RuleFunc
+}
+
+// DefaultRules is the chain of rewrite rules an Analyzer runs over a plan
+// before validating it against DefaultValidationRules. This trimmed copy
+// of the analyzer only carries the rule this series added; the full
+// tree's chain also resolves tables, subqueries and plain columns ahead
+// of StructFieldResolutionRule, which is why resolveStructFields only
+// ever sees columns that ordinary resolution left untouched.
+var DefaultRules = []Rule{
+	StructFieldResolutionRule,
+}
+
+// Analyzer runs a plan through Rules in order.
+type Analyzer struct {
+	Rules []Rule
+}
+
+// NewDefault returns an Analyzer configured with DefaultRules.
+func NewDefault() *Analyzer {
+	return &Analyzer{Rules: DefaultRules}
+}
+
+// Analyze runs n through a.Rules in order and returns the rewritten
+// plan. Callers validate the result against DefaultValidationRules
+// afterwards, the same way validateGroupBy and validateProjectTuples
+// depend on resolveStructFields having already run.
+func (a *Analyzer) Analyze(ctx *sql.Context, n sql.Node) (sql.Node, error) {
+	var err error
+	for _, rule := range a.Rules {
+		n, err = rule.Apply(ctx, a, n)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
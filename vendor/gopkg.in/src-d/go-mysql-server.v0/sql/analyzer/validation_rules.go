@@ -70,7 +70,7 @@ func validateOrderBy(ctx *sql.Context, n sql.Node) error {
 }
 
 func validateGroupBy(ctx *sql.Context, n sql.Node) error {
-	span, ctx := ctx.Span("validate_order_by")
+	span, ctx := ctx.Span("validate_group_by")
 	defer span.Finish()
 
 	switch n := n.(type) {
@@ -81,19 +81,11 @@ func validateGroupBy(ctx *sql.Context, n sql.Node) error {
 			return nil
 		}
 
-		var validAggs []string
-		for _, expr := range n.Grouping {
-			validAggs = append(validAggs, expr.String())
-		}
+		grouping := newGroupingSet(n.Grouping)
 
-		// TODO: validate columns inside aggregations
-		// and allow any kind of expression that make use of the grouping
-		// columns.
 		for _, expr := range n.Aggregate {
-			if _, ok := expr.(sql.Aggregation); !ok {
-				if !isValidAgg(validAggs, expr) {
-					return ErrValidationGroupBy.New(expr.String())
-				}
+			if bad := grouping.findUngroupedRef(expr); bad != nil {
+				return ErrValidationGroupBy.New(bad.String())
 			}
 		}
 
@@ -103,15 +95,60 @@ func validateGroupBy(ctx *sql.Context, n sql.Node) error {
 	return nil
 }
 
-func isValidAgg(validAggs []string, expr sql.Expression) bool {
+// groupingSet is the set of expressions a non-aggregate projection in a
+// GROUP BY is allowed to reference directly: each grouping expression,
+// identified by its string form, plus the alias it was given, if any.
+type groupingSet map[string]bool
+
+func newGroupingSet(grouping []sql.Expression) groupingSet {
+	set := make(groupingSet, len(grouping))
+	for _, expr := range grouping {
+		set[expr.String()] = true
+		if alias, ok := expr.(*expression.Alias); ok {
+			set[alias.Name()] = true
+		}
+	}
+
+	return set
+}
+
+// findUngroupedRef walks expr looking for the first leaf column reference
+// that is not functionally determined by the grouping set: it must
+// either be a grouping expression itself (or an alias of one), or expr
+// must be built entirely out of such columns and constants, e.g.
+// floor(g)*ceil(g) when g is grouped. Constants and no-arg functions like
+// RAND() are allowed too, since they don't read any ungrouped column. It
+// returns the smallest offending sub-expression, or nil if expr is valid.
+func (g groupingSet) findUngroupedRef(expr sql.Expression) sql.Expression {
 	switch expr := expr.(type) {
 	case sql.Aggregation:
-		return true
+		// The aggregation collapses the grouping set, so whatever column
+		// it reads from is fine.
+		return nil
 	case *expression.Alias:
-		return isValidAgg(validAggs, expr.Child)
-	default:
-		return stringContains(validAggs, expr.String())
+		return g.findUngroupedRef(expr.Child)
+	}
+
+	if g[expr.String()] {
+		return nil
 	}
+
+	if gf, ok := expr.(*expression.GetField); ok {
+		return gf
+	}
+
+	// A *StructFieldGetter (e.g. the "name" field of a "tree_entry"
+	// struct column, resolved from "t.tree_entry.name") falls through to
+	// here and is checked via its single child below: it's valid as long
+	// as the struct column itself is grouped, the same way any other
+	// expression built out of grouping columns is.
+	for _, child := range expr.Children() {
+		if bad := g.findUngroupedRef(child); bad != nil {
+			return bad
+		}
+	}
+
+	return nil
 }
 
 func validateSchemaSource(ctx *sql.Context, n sql.Node) error {
@@ -140,6 +177,11 @@ func validateSchema(t sql.Table) error {
 	return nil
 }
 
+// validateProjectTuples rejects a projection with more than one column
+// packed into a single selected field. A struct field access resolved by
+// resolveStructFields (e.g. te.tree_entry.name) is a *StructFieldGetter
+// whose Type() is the field's own scalar type, not a tuple, so it
+// naturally passes through here untouched.
 func validateProjectTuples(ctx *sql.Context, n sql.Node) error {
 	span, ctx := ctx.Span("validate_project_tuples")
 	defer span.Finish()
@@ -160,12 +202,3 @@ func validateProjectTuples(ctx *sql.Context, n sql.Node) error {
 	}
 	return nil
 }
-
-func stringContains(strs []string, target string) bool {
-	for _, s := range strs {
-		if s == target {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,98 @@
+package analyzer
+
+import (
+	"testing"
+
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/src-d/go-mysql-server.v0/sql/expression"
+)
+
+// fakeExpr is a minimal sql.Expression used to exercise
+// groupingSet.findUngroupedRef against arbitrary expression shapes
+// without depending on concrete function expressions.
+type fakeExpr struct {
+	str      string
+	children []sql.Expression
+}
+
+func (e *fakeExpr) Resolved() bool            { return true }
+func (e *fakeExpr) IsNullable() bool          { return false }
+func (e *fakeExpr) Type() sql.Type            { return sql.Text }
+func (e *fakeExpr) Name() string              { return e.str }
+func (e *fakeExpr) String() string            { return e.str }
+func (e *fakeExpr) Children() []sql.Expression { return e.children }
+
+func (e *fakeExpr) TransformUp(f sql.TransformExprFunc) (sql.Expression, error) {
+	return f(e)
+}
+
+func (e *fakeExpr) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	return nil, nil
+}
+
+func col(name string) sql.Expression {
+	return expression.NewGetField(0, sql.Text, name, false)
+}
+
+func TestFindUngroupedRef(t *testing.T) {
+	g := newGroupingSet([]sql.Expression{col("g")})
+
+	testCases := []struct {
+		name string
+		expr sql.Expression
+		bad  bool
+	}{
+		{"grouped column", col("g"), false},
+		{"ungrouped column", col("other"), true},
+		{
+			"deterministic function over grouped column",
+			&fakeExpr{str: "floor(g)", children: []sql.Expression{col("g")}},
+			false,
+		},
+		{
+			"deterministic function over ungrouped column",
+			&fakeExpr{str: "floor(other)", children: []sql.Expression{col("other")}},
+			true,
+		},
+		{
+			"function mixing grouped and ungrouped columns",
+			&fakeExpr{str: "g + other", children: []sql.Expression{col("g"), col("other")}},
+			true,
+		},
+		{"constant / no-arg function", &fakeExpr{str: "RAND()"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bad := g.findUngroupedRef(tc.expr)
+			if tc.bad && bad == nil {
+				t.Fatal("expected an offending sub-expression, got none")
+			}
+			if !tc.bad && bad != nil {
+				t.Fatalf("expected no offending sub-expression, got %q", bad.String())
+			}
+		})
+	}
+}
+
+func TestFindUngroupedRefAlias(t *testing.T) {
+	g := newGroupingSet([]sql.Expression{expression.NewAlias("g", col("x"))})
+
+	if bad := g.findUngroupedRef(col("g")); bad != nil {
+		t.Fatalf("expected the grouping alias %q to be a valid reference, got %q", "g", bad.String())
+	}
+}
+
+func TestFindUngroupedRefStructField(t *testing.T) {
+	g := newGroupingSet([]sql.Expression{col("t.tree_entry")})
+
+	grouped := NewStructFieldGetter(col("t.tree_entry"), "name", sql.Text)
+	if bad := g.findUngroupedRef(grouped); bad != nil {
+		t.Fatalf("expected a field of a grouped struct column to be valid, got %q", bad.String())
+	}
+
+	ungrouped := NewStructFieldGetter(col("t.other"), "name", sql.Text)
+	if bad := g.findUngroupedRef(ungrouped); bad == nil {
+		t.Fatal("expected a field of an ungrouped struct column to be invalid")
+	}
+}